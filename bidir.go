@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// conflictPolicy controls what bidir mode does when a path changed on
+// both sides since the last sync.
+type conflictPolicy string
+
+const (
+	conflictNewerWins  conflictPolicy = "newer-wins"
+	conflictSourceWins conflictPolicy = "source-wins"
+	conflictDestWins   conflictPolicy = "dest-wins"
+	conflictFail       conflictPolicy = "fail"
+)
+
+func parseConflictPolicy(s string) (conflictPolicy, error) {
+	switch conflictPolicy(s) {
+	case conflictNewerWins, conflictSourceWins, conflictDestWins, conflictFail:
+		return conflictPolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid -conflict %#v: must be one of newer-wins, source-wins, dest-wins, fail", s)
+	}
+}
+
+// syncBidir reconciles srcPath and dstPath in both directions: a file
+// new or changed on one side since the last run is copied to the other,
+// and a file deleted on one side is deleted on the other. statePath
+// records the mtime+size last synced on each side so a change can be
+// attributed to the right side; a path changed on both sides, or changed
+// on one and deleted on the other, since the last run is a conflict,
+// resolved per policy rather than silently picking a winner. A path
+// deleted on both sides is simply dropped from the state. Unlike push/mirror mode's worker pool,
+// this walks both trees up front and reconciles them one path at a time
+// in a single goroutine: every decision can touch shared state (the
+// conflict list, the state file), so the bookkeeping isn't worth
+// parallelizing here.
+func syncBidir(src Filesystem, srcPath string, dst Filesystem, dstPath string, statePath string, policy conflictPolicy) error {
+	state, err := loadBidirState(statePath)
+	if err != nil {
+		return err
+	}
+
+	srcFiles, err := listFiles(src, srcPath)
+	if err != nil {
+		return err
+	}
+	dstFiles, err := listFiles(dst, dstPath)
+	if err != nil {
+		return err
+	}
+
+	paths := map[string]bool{}
+	for p := range srcFiles {
+		paths[p] = true
+	}
+	for p := range dstFiles {
+		paths[p] = true
+	}
+	for _, p := range state.paths() {
+		paths[p] = true
+	}
+
+	var conflicts []string
+	for relativePath := range paths {
+		srcInfo, srcExists := srcFiles[relativePath]
+		dstInfo, dstExists := dstFiles[relativePath]
+		prev, hadPrev := state.get(relativePath)
+
+		srcChanged := srcExists && (!hadPrev || !prev.SrcExists || changedSince(srcInfo, prev.SrcMTime, prev.SrcSize))
+		dstChanged := dstExists && (!hadPrev || !prev.DstExists || changedSince(dstInfo, prev.DstMTime, prev.DstSize))
+		srcGone := !srcExists && hadPrev && prev.SrcExists
+		dstGone := !dstExists && hadPrev && prev.DstExists
+
+		switch {
+		case !srcExists && !dstExists:
+			state.delete(relativePath)
+
+		case srcGone && dstGone:
+			state.delete(relativePath)
+
+		case srcGone && !dstChanged:
+			log.Printf("%s: deleting from destination; deleted from source", relativePath)
+			dstFullPath := path.Join(dstPath, relativePath)
+			if err := dst.Remove(context.Background(), dstFullPath); err != nil && !dst.IsNotExist(err) {
+				return err
+			}
+			state.delete(relativePath)
+
+		case dstGone && !srcChanged:
+			log.Printf("%s: deleting from source; deleted from destination", relativePath)
+			srcFullPath := path.Join(srcPath, relativePath)
+			if err := src.Remove(context.Background(), srcFullPath); err != nil && !src.IsNotExist(err) {
+				return err
+			}
+			state.delete(relativePath)
+
+		case srcChanged && dstChanged, (srcGone && dstChanged), (dstGone && srcChanged):
+			action, err := resolveConflict(policy, srcExists, srcInfo, dstExists, dstInfo)
+			if err != nil {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s", relativePath, err.Error()))
+				continue
+			}
+			if err := applyConflictAction(action, src, srcPath, dst, dstPath, relativePath, state); err != nil {
+				return err
+			}
+
+		case srcChanged:
+			log.Printf("%s: copying source -> destination", relativePath)
+			if _, err := copyFile(src, path.Join(srcPath, relativePath), dst, path.Join(dstPath, relativePath), nil); err != nil {
+				return err
+			}
+			if err := recordSynced(state, relativePath, src, srcPath, dst, dstPath); err != nil {
+				return err
+			}
+
+		case dstChanged:
+			log.Printf("%s: copying destination -> source", relativePath)
+			if _, err := copyFile(dst, path.Join(dstPath, relativePath), src, path.Join(srcPath, relativePath), nil); err != nil {
+				return err
+			}
+			if err := recordSynced(state, relativePath, src, srcPath, dst, dstPath); err != nil {
+				return err
+			}
+
+		default:
+			// unchanged on both sides since the last sync; nothing to do
+		}
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("bidir sync found %d conflict(s):\n%s", len(conflicts), strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
+
+// changedSince reports whether info differs from the mtime+size last
+// recorded for it, the same comparison syncState.isUpToDate makes.
+func changedSince(info os.FileInfo, prevMTime time.Time, prevSize int64) bool {
+	return !(prevMTime.Equal(info.ModTime().Truncate(time.Second)) && prevSize == info.Size())
+}
+
+// recordSynced re-stats both sides after a copy and records the result,
+// rather than trusting the pre-copy os.FileInfo, since a backend's
+// writer does not always preserve the source's mtime exactly.
+func recordSynced(state *bidirState, relativePath string, src Filesystem, srcRoot string, dst Filesystem, dstRoot string) error {
+	srcInfo, err := src.Stat(path.Join(srcRoot, relativePath))
+	if err != nil {
+		return err
+	}
+	dstInfo, err := dst.Stat(path.Join(dstRoot, relativePath))
+	if err != nil {
+		return err
+	}
+	state.set(relativePath, bidirEntry{
+		SrcExists: true, SrcMTime: srcInfo.ModTime().Truncate(time.Second), SrcSize: srcInfo.Size(),
+		DstExists: true, DstMTime: dstInfo.ModTime().Truncate(time.Second), DstSize: dstInfo.Size(),
+	})
+	return nil
+}
+
+type conflictAction int
+
+const (
+	actionCopySrcToDst conflictAction = iota
+	actionCopyDstToSrc
+	actionDeleteDst
+	actionDeleteSrc
+)
+
+// resolveConflict decides what to do about a path that changed on both
+// sides since the last sync, or changed on one side and was deleted on
+// the other. A deleted side is treated
+// as "the other side's live copy wins" under newer-wins, since there's
+// no mtime to compare a deletion against an edit by.
+func resolveConflict(policy conflictPolicy, srcExists bool, srcInfo os.FileInfo, dstExists bool, dstInfo os.FileInfo) (conflictAction, error) {
+	switch policy {
+	case conflictFail:
+		return 0, fmt.Errorf("conflicting changes on both sides since the last sync")
+	case conflictSourceWins:
+		if srcExists {
+			return actionCopySrcToDst, nil
+		}
+		return actionDeleteDst, nil
+	case conflictDestWins:
+		if dstExists {
+			return actionCopyDstToSrc, nil
+		}
+		return actionDeleteSrc, nil
+	case conflictNewerWins:
+		if !srcExists {
+			return actionCopyDstToSrc, nil
+		}
+		if !dstExists {
+			return actionCopySrcToDst, nil
+		}
+		if srcInfo.ModTime().After(dstInfo.ModTime()) {
+			return actionCopySrcToDst, nil
+		}
+		return actionCopyDstToSrc, nil
+	default:
+		return 0, fmt.Errorf("unknown conflict policy %#v", policy)
+	}
+}
+
+func applyConflictAction(
+	action conflictAction, src Filesystem, srcRoot string, dst Filesystem, dstRoot string, relativePath string, state *bidirState,
+) error {
+	srcFullPath := path.Join(srcRoot, relativePath)
+	dstFullPath := path.Join(dstRoot, relativePath)
+
+	switch action {
+	case actionCopySrcToDst:
+		log.Printf("%s: conflict resolved by copying source -> destination", relativePath)
+		if _, err := copyFile(src, srcFullPath, dst, dstFullPath, nil); err != nil {
+			return err
+		}
+		return recordSynced(state, relativePath, src, srcRoot, dst, dstRoot)
+
+	case actionCopyDstToSrc:
+		log.Printf("%s: conflict resolved by copying destination -> source", relativePath)
+		if _, err := copyFile(dst, dstFullPath, src, srcFullPath, nil); err != nil {
+			return err
+		}
+		return recordSynced(state, relativePath, src, srcRoot, dst, dstRoot)
+
+	case actionDeleteDst:
+		log.Printf("%s: conflict resolved by deleting from destination", relativePath)
+		if err := dst.Remove(context.Background(), dstFullPath); err != nil && !dst.IsNotExist(err) {
+			return err
+		}
+		state.delete(relativePath)
+		return nil
+
+	case actionDeleteSrc:
+		log.Printf("%s: conflict resolved by deleting from source", relativePath)
+		if err := src.Remove(context.Background(), srcFullPath); err != nil && !src.IsNotExist(err) {
+			return err
+		}
+		state.delete(relativePath)
+		return nil
+	}
+	return fmt.Errorf("unknown conflict action %d", action)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	if _, err := parseConflictPolicy("newer-wins"); err != nil {
+		t.Errorf("parseConflictPolicy(newer-wins) = %#v; expected nil", err)
+	}
+	if _, err := parseConflictPolicy("bogus"); err == nil {
+		t.Errorf("parseConflictPolicy(bogus) = nil; expected an error")
+	}
+}
+
+func TestResolveConflictNewerWinsPicksLaterMTime(t *testing.T) {
+	older := fakeFileInfo{modTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := fakeFileInfo{modTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	action, err := resolveConflict(conflictNewerWins, true, older, true, newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != actionCopyDstToSrc {
+		t.Errorf("action = %v; expected actionCopyDstToSrc (destination is newer)", action)
+	}
+
+	action, err = resolveConflict(conflictNewerWins, true, newer, true, older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != actionCopySrcToDst {
+		t.Errorf("action = %v; expected actionCopySrcToDst (source is newer)", action)
+	}
+}
+
+func TestResolveConflictFailAlwaysErrors(t *testing.T) {
+	info := fakeFileInfo{}
+	if _, err := resolveConflict(conflictFail, true, info, true, info); err == nil {
+		t.Errorf("resolveConflict(conflictFail, ...) = nil error; expected one")
+	}
+}
+
+func TestChangedSince(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := fakeFileInfo{modTime: mtime, size: 10}
+	if changedSince(info, mtime, 10) {
+		t.Errorf("changedSince with matching mtime/size = true; expected false")
+	}
+	if !changedSince(info, mtime, 11) {
+		t.Errorf("changedSince with different size = false; expected true")
+	}
+}
+
+// TestSyncBidirReconciles drives syncBidir itself, end to end, across
+// three runs against real file:// trees: unlike the unit tests above,
+// which call resolveConflict/changedSince in isolation, this is the
+// bidir counterpart of mirror_test.go's TestMirrorDeletionsRemovesStaleFiles
+// and catches a regression in how syncBidir wires those pieces together.
+func TestSyncBidirReconciles(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sftpsync-bidir-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "sftpsync-bidir-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+	stateDir, err := ioutil.TempDir("", "sftpsync-bidir-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+	statePath := filepath.Join(stateDir, "state.json")
+
+	fs, _, err := openFilesystemURL("file://" + srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run 1: a file new on each side should be copied to the other.
+	writeFile(t, filepath.Join(srcDir, "alpha"), "from source")
+	writeFile(t, filepath.Join(dstDir, "beta"), "from destination")
+
+	if err := syncBidir(fs, srcDir, fs, dstDir, statePath, conflictNewerWins); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContents(t, filepath.Join(dstDir, "alpha"), "from source")
+	assertFileContents(t, filepath.Join(srcDir, "beta"), "from destination")
+
+	// Run 2: deleting alpha from the source, with the destination copy
+	// untouched since run 1, should delete it from the destination too.
+	if err := os.Remove(filepath.Join(srcDir, "alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncBidir(fs, srcDir, fs, dstDir, statePath, conflictNewerWins); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "alpha")); !os.IsNotExist(err) {
+		t.Errorf("alpha still exists in the destination after being deleted from the source: %v", err)
+	}
+
+	// Run 3: a conflict, changed on both sides since run 1. newer-wins
+	// should pick the destination's copy, since it's touched last.
+	writeFile(t, filepath.Join(srcDir, "beta"), "source's conflicting edit")
+	writeFile(t, filepath.Join(dstDir, "beta"), "destination's conflicting edit")
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+	if err := os.Chtimes(filepath.Join(srcDir, "beta"), older, older); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dstDir, "beta"), newer, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syncBidir(fs, srcDir, fs, dstDir, statePath, conflictNewerWins); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContents(t, filepath.Join(srcDir, "beta"), "destination's conflicting edit")
+	assertFileContents(t, filepath.Join(dstDir, "beta"), "destination's conflicting edit")
+}
+
+func assertFileContents(t *testing.T, path string, want string) {
+	t.Helper()
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s contents = %#v; expected %#v", path, string(got), want)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultBidirStatePath derives a stable bidir state file location from
+// the source and destination URLs, the same way defaultStatePath does
+// for push/mirror mode. It hashes in a "bidir" prefix so the same
+// source/destination pair doesn't collide with a push-mode state file,
+// which has an incompatible schema.
+func defaultBidirStatePath(sourceURL string, destinationURL string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	dir := filepath.Join(cacheDir, "sftpsync")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte("bidir\x00" + sourceURL + "\x00" + destinationURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".bidir.json"), nil
+}
+
+// bidirState is bidir mode's counterpart of syncState: for each relative
+// path, it remembers the mtime+size last observed on *each* side, so a
+// later run can tell whether a change originated on the source, on the
+// destination, or (a true conflict) both, since the last sync.
+type bidirState struct {
+	mu   sync.Mutex
+	path string
+
+	Entries map[string]bidirEntry `json:"entries"`
+}
+
+type bidirEntry struct {
+	SrcExists bool      `json:"srcExists"`
+	SrcMTime  time.Time `json:"srcMtime"`
+	SrcSize   int64     `json:"srcSize"`
+	DstExists bool      `json:"dstExists"`
+	DstMTime  time.Time `json:"dstMtime"`
+	DstSize   int64     `json:"dstSize"`
+}
+
+func loadBidirState(path string) (*bidirState, error) {
+	state := &bidirState{path: path, Entries: map[string]bidirEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Entries == nil {
+		state.Entries = map[string]bidirEntry{}
+	}
+	return state, nil
+}
+
+// save writes the state file atomically, the same way syncState.save
+// does: to a uniquely-named temp file in the same directory, then
+// renamed into place, so two callers saving concurrently can't race each
+// other's os.Rename over a shared tmp path.
+func (s *bidirState) save() error {
+	s.mu.Lock()
+	data, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return writeErr
+	}
+	if closeErr != nil {
+		os.Remove(tmpPath)
+		return closeErr
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *bidirState) get(relativePath string) (bidirEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.Entries[relativePath]
+	return entry, ok
+}
+
+func (s *bidirState) set(relativePath string, entry bidirEntry) {
+	s.mu.Lock()
+	s.Entries[relativePath] = entry
+	s.mu.Unlock()
+}
+
+func (s *bidirState) delete(relativePath string) {
+	s.mu.Lock()
+	delete(s.Entries, relativePath)
+	s.mu.Unlock()
+}
+
+// paths returns every relative path this state has an entry for.
+func (s *bidirState) paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.Entries))
+	for p := range s.Entries {
+		out = append(out, p)
+	}
+	return out
+}
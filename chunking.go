@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Chunk sizes for the content-defined chunker: the rolling hash targets
+// an average of 1 MiB (chunkAvgMask is a 20-bit mask), clamped so a
+// pathological input can't produce degenerate chunk counts.
+const (
+	chunkMinSize = 512 * 1024
+	chunkMaxSize = 8 * 1024 * 1024
+	chunkAvgMask = 1<<20 - 1
+
+	rollingWindowSize        = 64
+	rollingMultiplier uint64 = 1099511628211
+)
+
+// rollingMultiplierPow is rollingMultiplier^(rollingWindowSize-1), the
+// weight of the oldest byte in a full window.
+var rollingMultiplierPow = func() uint64 {
+	p := uint64(1)
+	for i := 0; i < rollingWindowSize-1; i++ {
+		p *= rollingMultiplier
+	}
+	return p
+}()
+
+// rabinChunker splits a byte stream into content-defined chunks using a
+// polynomial rolling hash (a Rabin fingerprint) over a sliding 64-byte
+// window. A boundary falls wherever the low bits of the hash match
+// chunkAvgMask; chunkMinSize/chunkMaxSize clamp the ends. Unlike
+// fixed-size chunking, this means an insertion or deletion in the middle
+// of a file only changes the chunks around the edit, not every chunk
+// after it, so unmodified regions re-hash to the same chunks.
+type rabinChunker struct {
+	r      *bufio.Reader
+	window [rollingWindowSize]byte
+	pos    int
+	filled int
+	hash   uint64
+}
+
+func newRabinChunker(r io.Reader) *rabinChunker {
+	return &rabinChunker{r: bufio.NewReader(r)}
+}
+
+// Next returns the next chunk, or io.EOF once the stream is exhausted.
+func (c *rabinChunker) Next() ([]byte, error) {
+	var chunk []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				if len(chunk) == 0 {
+					return nil, io.EOF
+				}
+				return chunk, nil
+			}
+			return nil, err
+		}
+		chunk = append(chunk, b)
+
+		if c.filled == rollingWindowSize {
+			outgoing := uint64(c.window[c.pos])
+			c.hash = (c.hash-outgoing*rollingMultiplierPow)*rollingMultiplier + uint64(b)
+		} else {
+			c.hash = c.hash*rollingMultiplier + uint64(b)
+			c.filled++
+		}
+		c.window[c.pos] = b
+		c.pos = (c.pos + 1) % rollingWindowSize
+
+		if len(chunk) >= chunkMaxSize {
+			return chunk, nil
+		}
+		if len(chunk) >= chunkMinSize && c.filled == rollingWindowSize && c.hash&chunkAvgMask == chunkAvgMask {
+			return chunk, nil
+		}
+	}
+}
+
+// chunkManifest is written to the destination path in place of the file
+// itself when copying with chunking enabled.
+type chunkManifest struct {
+	ModTime time.Time    `json:"mtime"`
+	Size    int64        `json:"size"`
+	Chunks  []chunkEntry `json:"chunks"`
+}
+
+type chunkEntry struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func chunkStorePath(dstRoot string, hash string) string {
+	return path.Join(dstRoot, "chunks", hash)
+}
+
+func readManifest(dst Filesystem, manifestPath string) (*chunkManifest, error) {
+	reader, err := dst.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &chunkManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// needsChunkedUpload is runSync's mtime/size skip check for chunked mode,
+// made against the manifest's recorded mtime/size rather than the
+// manifest object's own (since the manifest is a small JSON blob, not the
+// file). copyFileChunked records the source's own mtime, so an unchanged
+// file is one whose recorded mtime equals the source's.
+func needsChunkedUpload(dst Filesystem, manifestPath string, srcInfo os.FileInfo) (bool, error) {
+	manifest, err := readManifest(dst, manifestPath)
+	if err != nil {
+		if dst.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	srcTime := srcInfo.ModTime().Truncate(time.Second)
+	dstTime := manifest.ModTime.Truncate(time.Second)
+	return !(dstTime.Equal(srcTime) && manifest.Size == srcInfo.Size()), nil
+}
+
+// copyFileChunked uploads srcPath from src in content-defined chunks,
+// deduplicated against dstRoot/chunks/<sha256> on dst, and writes a
+// small manifest to manifestPath pointing at them. This cuts re-upload
+// cost for large, partially-modified files (log archives, DB dumps)
+// since chunks that already exist from a previous sync are never
+// re-uploaded. It returns the file's logical size (not the number of
+// bytes actually uploaded, since dedup may skip some chunks), matching
+// copyFile's return value for callers that track bytes transferred.
+// A non-nil limiter throttles reading srcPath.
+func copyFileChunked(src Filesystem, srcPath string, dst Filesystem, dstRoot string, manifestPath string, limiter *rate.Limiter) (int64, error) {
+	info, err := src.Stat(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := src.Open(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	manifest := chunkManifest{ModTime: info.ModTime(), Size: info.Size()}
+	chunker := newRabinChunker(newRateLimitedReader(reader, limiter))
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		manifest.Chunks = append(manifest.Chunks, chunkEntry{SHA256: hash, Size: int64(len(chunk))})
+
+		if err := uploadChunkIfMissing(dst, chunkStorePath(dstRoot, hash), chunk); err != nil {
+			return 0, err
+		}
+	}
+	if err := reader.Close(); err != nil {
+		return 0, err
+	}
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	writer, err := dst.NewWriter(ctx, manifestPath)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := writer.Write(manifestBytes); err != nil {
+		writer.Close()
+		return 0, err
+	}
+	return info.Size(), writer.Close()
+}
+
+func uploadChunkIfMissing(dst Filesystem, chunkPath string, chunk []byte) error {
+	if _, err := dst.Stat(chunkPath); err == nil {
+		return nil // a previous sync already uploaded this chunk
+	} else if !dst.IsNotExist(err) {
+		return err
+	}
+
+	ctx := context.Background()
+	writer, err := dst.NewWriter(ctx, chunkPath)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(chunk); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// RestoreChunked reassembles a file previously uploaded with chunking
+// enabled, reading its manifest from manifestPath and its chunks from
+// dstRoot/chunks/ on src, and writing the reassembled file to dstPath on
+// dst. It exists mainly to verify that a chunked upload round-trips:
+// restoring a file back over SFTP and comparing it against the original.
+func RestoreChunked(src Filesystem, dstRoot string, manifestPath string, dst Filesystem, dstPath string) error {
+	manifest, err := readManifest(src, manifestPath)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	writer, err := dst.NewWriter(ctx, dstPath)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	for _, entry := range manifest.Chunks {
+		reader, err := src.Open(chunkStorePath(dstRoot, entry.SHA256))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// verifyChunkedUpload restores the manifest just written to manifestPath
+// back from dst's chunk store into a scratch local file, and compares it
+// against srcPath, so -verify-chunked can catch a corrupted upload or a
+// chunker bug right after it happens instead of trusting the manifest
+// until something downstream notices a mismatch.
+func verifyChunkedUpload(src Filesystem, srcPath string, dst Filesystem, dstRoot string, manifestPath string) error {
+	tmp, err := ioutil.TempFile("", "sftpsync-verify-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	local := &localFilesystem{}
+	if err := RestoreChunked(dst, dstRoot, manifestPath, local, tmpPath); err != nil {
+		return fmt.Errorf("restoring %s for verification: %s", manifestPath, err.Error())
+	}
+
+	srcSum, err := fileSHA256(src, srcPath)
+	if err != nil {
+		return err
+	}
+	restoredSum, err := fileSHA256(local, tmpPath)
+	if err != nil {
+		return err
+	}
+	if srcSum != restoredSum {
+		return fmt.Errorf("%s: restored upload does not match source (sha256 %s vs %s)", srcPath, restoredSum, srcSum)
+	}
+	return nil
+}
+
+func fileSHA256(fs Filesystem, path string) (string, error) {
+	reader, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
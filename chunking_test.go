@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRabinChunkerRoundTrips(t *testing.T) {
+	data := make([]byte, 5*chunkMinSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	chunker := newRabinChunker(bytes.NewReader(data))
+	var reassembled []byte
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > chunkMaxSize {
+			t.Errorf("chunk size %d exceeds chunkMaxSize %d", len(chunk), chunkMaxSize)
+		}
+		reassembled = append(reassembled, chunk...)
+	}
+	if !bytes.Equal(reassembled, data) {
+		t.Errorf("reassembled data does not match original: got %d bytes, expected %d", len(reassembled), len(data))
+	}
+}
+
+func TestRabinChunkerEmptyInput(t *testing.T) {
+	chunker := newRabinChunker(bytes.NewReader(nil))
+	_, err := chunker.Next()
+	if err != io.EOF {
+		t.Errorf("Next() on empty input = %#v; expected io.EOF", err)
+	}
+}
+
+func TestCopyFileChunkedRoundTripsThroughRestoreChunked(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sftpsync-chunked-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "sftpsync-chunked-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	data := make([]byte, 3*chunkMinSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	srcPath := filepath.Join(srcDir, "file")
+	if err := ioutil.WriteFile(srcPath, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &localFilesystem{}
+	manifestPath := filepath.Join(dstDir, "file")
+	if _, err := copyFileChunked(fs, srcPath, fs, dstDir, manifestPath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyChunkedUpload(fs, srcPath, fs, dstDir, manifestPath); err != nil {
+		t.Errorf("verifyChunkedUpload on a good upload = %s; expected nil", err.Error())
+	}
+
+	restoredPath := filepath.Join(srcDir, "restored")
+	if err := RestoreChunked(fs, dstDir, manifestPath, fs, restoredPath); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ioutil.ReadFile(restoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Errorf("restored content does not match original: got %d bytes, expected %d", len(restored), len(data))
+	}
+}
+
+func TestVerifyChunkedUploadDetectsCorruption(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sftpsync-chunked-corrupt-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	dstDir, err := ioutil.TempDir("", "sftpsync-chunked-corrupt-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	data := make([]byte, 2*chunkMinSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	srcPath := filepath.Join(srcDir, "file")
+	if err := ioutil.WriteFile(srcPath, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &localFilesystem{}
+	manifestPath := filepath.Join(dstDir, "file")
+	if _, err := copyFileChunked(fs, srcPath, fs, dstDir, manifestPath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := readManifest(fs, manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(chunkStorePath(dstDir, manifest.Chunks[0].SHA256), []byte("corrupted"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyChunkedUpload(fs, srcPath, fs, dstDir, manifestPath); err == nil {
+		t.Errorf("verifyChunkedUpload on a corrupted chunk = nil; expected an error")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes the jobs a long-lived sftpsync process should run,
+// loaded from the file passed via -config.
+type Config struct {
+	// Addr is the address the Prometheus status endpoint listens on, e.g.
+	// ":9090". Empty disables the endpoint.
+	Addr string      `yaml:"addr"`
+	Jobs []JobConfig `yaml:"jobs"`
+}
+
+// JobConfig is a single named sync job: a source and destination URL plus
+// the same options available as flags to a one-shot sync. Schedule, if
+// set, is a standard 5-field cron expression ("*/15 * * * *"); if empty
+// the job runs once when the daemon starts and never again.
+type JobConfig struct {
+	Name          string   `yaml:"name"`
+	Source        string   `yaml:"source"`
+	Destination   string   `yaml:"destination"`
+	Include       []string `yaml:"include"`
+	Exclude       []string `yaml:"exclude"`
+	Bandwidth     string   `yaml:"bandwidth"`
+	Concurrency   int      `yaml:"concurrency"`
+	Chunked       bool     `yaml:"chunked"`
+	VerifyChunked bool     `yaml:"verifyChunked"`
+	Schedule      string   `yaml:"schedule"`
+	// Mode is push (the default), mirror, or bidir; see syncMode.
+	Mode string `yaml:"mode"`
+	// Conflict is bidir mode's policy for a path changed on both sides;
+	// see conflictPolicy. Ignored outside bidir mode.
+	Conflict string `yaml:"conflict"`
+}
+
+// loadConfig reads and validates a job config file. Only YAML is
+// supported: TOML's "key = value" and "[[jobs]]" array-of-tables syntax
+// isn't valid YAML, so a TOML file fails to parse here.
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config %#v: %s", path, err.Error())
+	}
+	if len(config.Jobs) == 0 {
+		return nil, fmt.Errorf("config %#v: no jobs defined", path)
+	}
+	seen := map[string]bool{}
+	for i, job := range config.Jobs {
+		if job.Name == "" {
+			return nil, fmt.Errorf("job %d: name cannot be empty", i)
+		}
+		if seen[job.Name] {
+			return nil, fmt.Errorf("job %#v: duplicate name", job.Name)
+		}
+		seen[job.Name] = true
+		if job.Source == "" || job.Destination == "" {
+			return nil, fmt.Errorf("job %#v: source and destination are required", job.Name)
+		}
+		if job.Mode == "" {
+			config.Jobs[i].Mode = string(modePush)
+		}
+		if _, err := parseSyncMode(config.Jobs[i].Mode); err != nil {
+			return nil, fmt.Errorf("job %#v: %s", job.Name, err.Error())
+		}
+		if job.Conflict == "" {
+			config.Jobs[i].Conflict = string(conflictNewerWins)
+		}
+		if _, err := parseConflictPolicy(config.Jobs[i].Conflict); err != nil {
+			return nil, fmt.Errorf("job %#v: %s", job.Name, err.Error())
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Walker iterates over the files beneath a root path, mirroring the
+// interface of sftp.Client.Walk so existing tree-walking code can stay
+// backend-agnostic.
+type Walker interface {
+	Step() bool
+	Err() error
+	Path() string
+	Stat() os.FileInfo
+}
+
+// RangeReader reads a (possibly partial) object and exposes the metadata
+// needed by sync to decide whether a re-upload is necessary.
+type RangeReader interface {
+	io.ReadCloser
+	ModTime() time.Time
+	Size() int64
+}
+
+// Filesystem is anything sync can read files from or write files to:
+// an SFTP server, a cloud storage bucket, or the local disk. Backends
+// register themselves against a URL scheme via registerFilesystem so
+// that openFilesystemURL can dispatch to the right implementation.
+type Filesystem interface {
+	// Open returns the contents of path for reading in full.
+	Open(path string) (io.ReadCloser, error)
+	// Stat returns metadata for path.
+	Stat(path string) (os.FileInfo, error)
+	// Walk returns a Walker rooted at root.
+	Walk(root string) Walker
+	// NewWriter returns a writer that (over)writes path. Closing the
+	// writer commits the write; cancelling ctx before Close aborts it.
+	NewWriter(ctx context.Context, path string) (io.WriteCloser, error)
+	// NewRangeReader reads length bytes of path starting at offset. A
+	// length of 0 means "just the metadata plus whatever the backend
+	// happens to return for a zero-length range".
+	NewRangeReader(ctx context.Context, path string, offset, length int64) (RangeReader, error)
+	// Remove deletes path, for mirror mode's deletion propagation and
+	// bidir's conflict resolution.
+	Remove(ctx context.Context, path string) error
+	// Close releases any underlying connection. It is safe to call on a
+	// Filesystem that never needed one.
+	Close() error
+	// IsNotExist reports whether err, as returned by any method of this
+	// Filesystem, means the path did not exist.
+	IsNotExist(err error) bool
+}
+
+// fsOpener parses a URL for a registered scheme and opens the resulting
+// Filesystem, returning the root path to operate on (the URL's path).
+type fsOpener func(parsed *url.URL) (fs Filesystem, rootPath string, err error)
+
+var fsRegistry = map[string]fsOpener{}
+
+// registerFilesystem registers opener as the handler for scheme. It is
+// meant to be called from the init() of each backend's file.
+func registerFilesystem(scheme string, opener fsOpener) {
+	if _, exists := fsRegistry[scheme]; exists {
+		panic("filesystem scheme already registered: " + scheme)
+	}
+	fsRegistry[scheme] = opener
+}
+
+// openFilesystemURL parses input, dispatches to the Filesystem registered
+// for its scheme, and returns the opened Filesystem plus the root path to
+// use for Walk/Open/NewWriter calls.
+func openFilesystemURL(input string) (fs Filesystem, rootPath string, err error) {
+	parsed, err := url.Parse(input)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URL: %s", err.Error())
+	}
+
+	opener, ok := fsRegistry[parsed.Scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported scheme: %#v", parsed.Scheme)
+	}
+	return opener(parsed)
+}
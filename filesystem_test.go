@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenFilesystemURLUnsupportedScheme(t *testing.T) {
+	_, _, err := openFilesystemURL("ftp://host/dir")
+	if err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Errorf("openFilesystemURL(ftp://...) = %#v; expected unsupported scheme error", err)
+	}
+}
+
+func TestLocalFilesystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftpsync-local-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, rootPath, err := openFilesystemURL("file://" + dir)
+	if err != nil {
+		t.Fatalf("openFilesystemURL(file://%s) = %#v", dir, err)
+	}
+	if rootPath != dir {
+		t.Errorf("rootPath = %#v; expected %#v", rootPath, dir)
+	}
+
+	filePath := filepath.Join(dir, "file")
+	writer, err := fs.NewWriter(context.Background(), filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	walker := fs.Walk(dir)
+	found := false
+	for walker.Step() {
+		if walker.Err() != nil {
+			t.Fatal(walker.Err())
+		}
+		if walker.Path() == filePath {
+			found = true
+			if walker.Stat().Size() != 5 {
+				t.Errorf("size = %d; expected 5", walker.Stat().Size())
+			}
+		}
+	}
+	if !found {
+		t.Errorf("walk of %#v did not find %#v", dir, filePath)
+	}
+
+	_, err = fs.Stat(filepath.Join(dir, "does-not-exist"))
+	if !fs.IsNotExist(err) {
+		t.Errorf("Stat of missing file = %#v; expected IsNotExist", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// matchesFilters reports whether relativePath (relative to the sync
+// root) should be synced, given a job's optional include/exclude glob
+// patterns. An exclude match always wins; an empty include list means
+// "everything not excluded matches".
+func matchesFilters(relativePath string, include []string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if globMatch(pattern, relativePath) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if globMatch(pattern, relativePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether pattern matches relativePath. path.Match's
+// "*" never crosses a "/", so a pattern with no "/" of its own (e.g.
+// "*.log", the ordinary way to write "exclude log files") is also
+// matched against just relativePath's last segment; that way it excludes
+// a nested match like "logs/2024/file.log" the way whoever wrote it
+// almost certainly meant, instead of only a bare top-level "file.log". A
+// pattern containing "/" is left to match the full path, so users can
+// still anchor a pattern to a specific subtree.
+func globMatch(pattern string, relativePath string) bool {
+	if ok, _ := path.Match(pattern, relativePath); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(relativePath)); ok {
+			return true
+		}
+	}
+	return false
+}
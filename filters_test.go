@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMatchesFilters(t *testing.T) {
+	cases := []struct {
+		path    string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{path: "a.txt", include: nil, exclude: nil, want: true},
+		{path: "a.txt", include: []string{"*.txt"}, exclude: nil, want: true},
+		{path: "a.jpg", include: []string{"*.txt"}, exclude: nil, want: false},
+		{path: "a.txt", include: nil, exclude: []string{"*.txt"}, want: false},
+		{path: "a.txt", include: []string{"*.txt"}, exclude: []string{"*.txt"}, want: false},
+		{path: "logs/2024/file.log", include: nil, exclude: []string{"*.log"}, want: false},
+		{path: "logs/2024/file.log", include: []string{"*.log"}, exclude: nil, want: true},
+		{path: "logs/2024/file.txt", include: nil, exclude: []string{"*.log"}, want: true},
+		{path: "a/logs/file.log", include: nil, exclude: []string{"a/logs/*.log"}, want: false},
+		{path: "b/logs/file.log", include: nil, exclude: []string{"a/logs/*.log"}, want: true},
+	}
+	for _, c := range cases {
+		if got := matchesFilters(c.path, c.include, c.exclude); got != c.want {
+			t.Errorf("matchesFilters(%#v, %#v, %#v) = %v; expected %v",
+				c.path, c.include, c.exclude, got, c.want)
+		}
+	}
+}
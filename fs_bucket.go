@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/google/go-cloud/blob"
+	"github.com/google/go-cloud/blob/azureblob"
+	"github.com/google/go-cloud/blob/gcsblob"
+	"github.com/google/go-cloud/blob/s3blob"
+	"github.com/google/go-cloud/gcp"
+)
+
+const schemeGCS = "gs"
+const schemeS3 = "s3"
+const schemeAzblob = "azblob"
+
+func init() {
+	registerFilesystem(schemeGCS, openBucketURL)
+	registerFilesystem(schemeS3, openBucketURL)
+	registerFilesystem(schemeAzblob, openBucketURL)
+}
+
+type cloudStorageURL struct {
+	provider string
+	bucket   string
+	path     string
+}
+
+func parseCloudStorageURL(input string) (cloudStorageURL, error) {
+	output := cloudStorageURL{path: "/"}
+	storageURL, err := url.Parse(input)
+	if err != nil {
+		return output, fmt.Errorf("invalid URL: %s", err.Error())
+	}
+
+	if !(storageURL.Scheme == schemeGCS || storageURL.Scheme == schemeS3 || storageURL.Scheme == schemeAzblob) {
+		return output, fmt.Errorf("invalid scheme: %s", storageURL.Scheme)
+	}
+	output.provider = storageURL.Scheme
+
+	if storageURL.Opaque != "" {
+		return output, fmt.Errorf("invalid URL")
+	}
+
+	if storageURL.User != nil {
+		return output, fmt.Errorf("username/password cannot be provided for cloud storage")
+	}
+
+	output.bucket = storageURL.Host
+	if strings.ContainsRune(output.bucket, ':') {
+		return output, fmt.Errorf("bucket cannot contain :")
+	}
+	if output.bucket == "" {
+		return output, fmt.Errorf("bucket cannot be empty")
+	}
+
+	if storageURL.Path != "" {
+		output.path = storageURL.Path
+	}
+
+	if storageURL.RawQuery != "" {
+		return output, fmt.Errorf("query must be empty")
+	}
+	if storageURL.Fragment != "" {
+		return output, fmt.Errorf("fragment must be empty")
+	}
+
+	return output, nil
+}
+
+// openBucketURL implements fsOpener for the gs://, s3:// and azblob://
+// schemes: they are all just blob.Bucket under the hood.
+func openBucketURL(parsed *url.URL) (Filesystem, string, error) {
+	storageURL, err := parseCloudStorageURL(parsed.String())
+	if err != nil {
+		return nil, "", err
+	}
+	bucket, err := openBucket(storageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	return &bucketFilesystem{bucket: bucket}, storageURL.path, nil
+}
+
+func openBucket(bucketURL cloudStorageURL) (*blob.Bucket, error) {
+	ctx := context.Background()
+	switch bucketURL.provider {
+	case schemeGCS:
+		credentials, err := gcp.DefaultCredentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		client, err := gcp.NewHTTPClient(gcp.DefaultTransport(), gcp.CredentialsTokenSource(credentials))
+		if err != nil {
+			return nil, err
+		}
+		return gcsblob.OpenBucket(ctx, bucketURL.bucket, client)
+	case schemeS3:
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			return nil, fmt.Errorf("Must specify AWS_REGION environment variable")
+		}
+		config := &aws.Config{
+			Region:      aws.String(region),
+			Credentials: credentials.NewEnvCredentials(),
+		}
+		sess, err := session.NewSession(config)
+		if err != nil {
+			return nil, err
+		}
+		return s3blob.OpenBucket(ctx, sess, bucketURL.bucket)
+	case schemeAzblob:
+		accountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
+		accountKey := os.Getenv("AZURE_STORAGE_KEY")
+		if accountName == "" || accountKey == "" {
+			return nil, fmt.Errorf("Must specify AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY environment variables")
+		}
+		credential, err := azureblob.NewCredential(azureblob.AccountName(accountName), azureblob.AccountKey(accountKey))
+		if err != nil {
+			return nil, err
+		}
+		pipeline := azureblob.NewPipeline(credential, azureblob.PipelineOptions{})
+		return azureblob.OpenBucket(ctx, pipeline, azureblob.AccountName(accountName), bucketURL.bucket, nil)
+	}
+
+	return nil, fmt.Errorf("unsupported provider: %s", bucketURL.provider)
+}
+
+// bucketFilesystem adapts a *blob.Bucket to the Filesystem interface.
+type bucketFilesystem struct {
+	bucket *blob.Bucket
+}
+
+// bucketKey strips the leading slash every path sftpsync passes around
+// otherwise carries (root paths from URL parsing, and the paths derived
+// from them by makeDestinationPath and its callers), since blob.Bucket
+// keys never have one. Walk's Path, symmetrically, adds the
+// slash back so a bucket used as a source produces paths that satisfy
+// those same callers' srcRoot/HasPrefix checks.
+func bucketKey(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+func (f *bucketFilesystem) Open(path string) (io.ReadCloser, error) {
+	ctx := context.Background()
+	// a negative length reads through to the end of the object
+	return f.bucket.NewRangeReader(ctx, bucketKey(path), 0, -1)
+}
+
+func (f *bucketFilesystem) Stat(path string) (os.FileInfo, error) {
+	ctx := context.Background()
+	reader, err := f.bucket.NewRangeReader(ctx, bucketKey(path), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return &bucketFileInfo{name: path, modTime: reader.ModTime(), size: reader.Size()}, nil
+}
+
+// Walk lists every object under root via blob.Bucket.List, now that
+// go-cloud exposes one (https://github.com/google/go-cloud/issues/241).
+func (f *bucketFilesystem) Walk(root string) Walker {
+	prefix := bucketKey(root)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &bucketWalker{ctx: context.Background(), iter: f.bucket.List(&blob.ListOptions{Prefix: prefix})}
+}
+
+func (f *bucketFilesystem) NewWriter(ctx context.Context, path string) (io.WriteCloser, error) {
+	return f.bucket.NewWriter(ctx, bucketKey(path), nil)
+}
+
+func (f *bucketFilesystem) NewRangeReader(
+	ctx context.Context, path string, offset, length int64,
+) (RangeReader, error) {
+	return f.bucket.NewRangeReader(ctx, bucketKey(path), offset, length)
+}
+
+func (f *bucketFilesystem) Remove(ctx context.Context, path string) error {
+	return f.bucket.Delete(ctx, bucketKey(path))
+}
+
+func (f *bucketFilesystem) Close() error {
+	return nil
+}
+
+func (f *bucketFilesystem) IsNotExist(err error) bool {
+	return blob.IsNotExist(err)
+}
+
+// bucketWalker adapts blob.Bucket's List iterator to the Walker
+// interface; unlike sftp.Client.Walk or localWalker it never descends
+// into directories since buckets are flat, but blob.ListObject already
+// gives each full object key.
+type bucketWalker struct {
+	ctx  context.Context
+	iter *blob.ListIterator
+	obj  *blob.ListObject
+	err  error
+}
+
+func (w *bucketWalker) Step() bool {
+	if w.err != nil {
+		return false
+	}
+	w.obj, w.err = w.iter.Next(w.ctx)
+	if w.err != nil {
+		if w.err == io.EOF {
+			w.err = nil
+		}
+		return false
+	}
+	return true
+}
+
+func (w *bucketWalker) Err() error { return w.err }
+
+func (w *bucketWalker) Path() string {
+	if w.obj == nil {
+		return ""
+	}
+	return "/" + w.obj.Key
+}
+
+func (w *bucketWalker) Stat() os.FileInfo {
+	if w.obj == nil {
+		return nil
+	}
+	return &bucketFileInfo{name: w.obj.Key, modTime: w.obj.ModTime, size: w.obj.Size}
+}
+
+type bucketFileInfo struct {
+	name    string
+	modTime time.Time
+	size    int64
+}
+
+func (i *bucketFileInfo) Name() string       { return i.name }
+func (i *bucketFileInfo) Size() int64        { return i.size }
+func (i *bucketFileInfo) Mode() os.FileMode  { return 0 }
+func (i *bucketFileInfo) ModTime() time.Time { return i.modTime }
+func (i *bucketFileInfo) IsDir() bool        { return false }
+func (i *bucketFileInfo) Sys() interface{}   { return nil }
+
+type logRoundTripper struct {
+	orig http.RoundTripper
+}
+
+func (l *logRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	log.Printf("req: %s %s", req.Method, req.URL.String())
+	resp, origErr := l.orig.RoundTrip(req)
+	log.Printf("resp: %d %#v", resp.StatusCode, resp.Header)
+	buf := &bytes.Buffer{}
+	_, err := io.Copy(buf, resp.Body)
+	err2 := resp.Body.Close()
+	if err != nil {
+		return resp, err
+	}
+	if err2 != nil {
+		return resp, err2
+	}
+	log.Printf("body: %s", string(buf.Bytes()))
+	resp.Body = ioutil.NopCloser(buf)
+	return resp, origErr
+}
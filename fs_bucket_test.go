@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cloud/blob/memblob"
+)
+
+func TestBucketFilesystemWalk(t *testing.T) {
+	fs := &bucketFilesystem{bucket: memblob.OpenBucket(nil)}
+	ctx := context.Background()
+
+	writer, err := fs.NewWriter(ctx, "dir/sub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	walker := fs.Walk("/dir")
+	found := false
+	for walker.Step() {
+		if walker.Err() != nil {
+			t.Fatal(walker.Err())
+		}
+		if walker.Path() == "/dir/sub/file" {
+			found = true
+			if walker.Stat().Size() != 5 {
+				t.Errorf("size = %d; expected 5", walker.Stat().Size())
+			}
+		}
+	}
+	if walker.Err() != nil {
+		t.Fatal(walker.Err())
+	}
+	if !found {
+		t.Fatalf("walk of /dir did not find /dir/sub/file")
+	}
+
+	// walker.Path() must start with the root it was given, the same way
+	// localWalker's and sftp.Client's do, since makeDestinationPath's
+	// callers (mirror, bidir, the push pass's filter check) all rely on
+	// srcRoot being a prefix of every path Walk returns.
+	relative := makeDestinationPath("/dir", "/dir/sub/file", "/")
+	if relative != "sub/file" {
+		t.Errorf("makeDestinationPath = %#v; expected %#v", relative, "sub/file")
+	}
+
+	reader, err := fs.Open("/dir/sub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("Open(/dir/sub/file) read %#v; expected %#v", string(data), "hello")
+	}
+}
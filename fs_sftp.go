@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const schemeSFTP = "sftp"
+const defaultSSHPort = 22
+
+func init() {
+	registerFilesystem(schemeSFTP, openSFTPURL)
+}
+
+type sftpSource struct {
+	username string
+	password string
+	hostname string
+	port     int
+	path     string
+}
+
+func parseSource(input string) (sftpSource, error) {
+	output := sftpSource{port: defaultSSHPort, path: "/"}
+	sftpURL, err := url.Parse(input)
+	if err != nil {
+		return output, fmt.Errorf("invalid sftp URL: %s", err.Error())
+	}
+
+	if sftpURL.Scheme != schemeSFTP {
+		return output, fmt.Errorf("scheme must be sftp (was %#v)", sftpURL.Scheme)
+	}
+	if sftpURL.Opaque != "" {
+		return output, fmt.Errorf("invalid sftp URL")
+	}
+	if sftpURL.User != nil {
+		output.username = sftpURL.User.Username()
+		if output.username == "" {
+			return output, fmt.Errorf("username cannot be empty")
+		}
+		isSet := false
+		output.password, isSet = sftpURL.User.Password()
+		if isSet && output.password == "" {
+			return output, fmt.Errorf("password cannot be empty")
+		}
+	}
+
+	output.hostname = sftpURL.Host
+	parts := strings.Split(output.hostname, ":")
+	if len(parts) == 2 {
+		output.hostname = parts[0]
+		output.port, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return output, fmt.Errorf("invalid port: %s", err.Error())
+		}
+		if !(1 <= output.port && output.port < (1<<16)) {
+			return output, fmt.Errorf("port out of range: %d", output.port)
+		}
+	}
+	if output.hostname == "" {
+		return output, fmt.Errorf("hostname cannot be empty")
+	}
+
+	if sftpURL.Path != "" {
+		output.path = sftpURL.Path
+	}
+
+	if sftpURL.RawQuery != "" {
+		return output, fmt.Errorf("query must be empty")
+	}
+	if sftpURL.Fragment != "" {
+		return output, fmt.Errorf("fragment must be empty")
+	}
+
+	return output, nil
+}
+
+// openSFTPURL implements fsOpener for the sftp:// scheme. It is used for
+// both sources and destinations, so sync can mirror in either direction
+// or even sftp-to-sftp.
+func openSFTPURL(parsed *url.URL) (Filesystem, string, error) {
+	source, err := parseSource(parsed.String())
+	if err != nil {
+		return nil, "", err
+	}
+	sshConn, sftpClient, err := connectSFTP(source)
+	if err != nil {
+		return nil, "", err
+	}
+	return &sftpFilesystem{sshConn: sshConn, sftpClient: sftpClient}, source.path, nil
+}
+
+func defaultClientConfig() (*ssh.ClientConfig, error) {
+	hostKeyCallback, err := newHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{HostKeyCallback: hostKeyCallback}
+
+	// attempt to use ssh agent if configured
+	if aConn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK")); err == nil {
+		auth := ssh.PublicKeysCallback(agent.NewClient(aConn).Signers)
+		config.Auth = append(config.Auth, auth)
+	}
+
+	currentUser, err := user.Current()
+	if err == nil {
+		config.User = currentUser.Username
+	}
+	return config, nil
+}
+
+func makePasswordPromptFunc(username string, host string) func() (string, error) {
+	return func() (string, error) {
+		os.Stdout.WriteString(fmt.Sprintf("%s@%s's Password: ", username, host))
+		passwordBytes, err := terminal.ReadPassword(0)
+		os.Stdout.Write([]byte("\n"))
+		return string(passwordBytes), err
+	}
+}
+
+// loadPrivateKey reads and parses an identity file, prompting for its
+// passphrase (via terminal.ReadPassword, same as the password prompt)
+// if it's encrypted.
+func loadPrivateKey(path string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err == nil {
+		return signer, nil
+	}
+	if _, isPassphraseErr := err.(*ssh.PassphraseMissingError); !isPassphraseErr {
+		return nil, err
+	}
+
+	os.Stdout.WriteString(fmt.Sprintf("Enter passphrase for key '%s': ", path))
+	passphrase, err := terminal.ReadPassword(0)
+	os.Stdout.Write([]byte("\n"))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(keyBytes, passphrase)
+}
+
+// addIdentityAuth adds a PublicKeys auth method for each identity file
+// that parses successfully, logging (rather than failing) the ones that
+// don't, since the agent or a password may still work.
+func addIdentityAuth(config *ssh.ClientConfig, identityFiles []string) {
+	for _, identityFile := range identityFiles {
+		signer, err := loadPrivateKey(identityFile)
+		if err != nil {
+			log.Printf("%s: skipping identity file: %s", identityFile, err.Error())
+			continue
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+}
+
+// dialSSH dials addr directly, or through proxyJump (an ssh_config
+// ProxyJump value) if set, resolving the jump host the same way as any
+// other host alias. The second return value is the ProxyJump connection
+// to the jump host, non-nil only when one was used; the caller must
+// close it alongside the returned client.
+func dialSSH(addr string, clientConfig *ssh.ClientConfig, proxyJump string) (*ssh.Client, *ssh.Client, error) {
+	if proxyJump == "" {
+		client, err := ssh.Dial("tcp", addr, clientConfig)
+		return client, nil, err
+	}
+
+	proxyHost, proxyUser, proxyPort := parseProxyJump(proxyJump)
+	proxyResolved := resolveSSHConfig(proxyHost)
+	if proxyUser == "" {
+		proxyUser = proxyResolved.user
+	}
+	if proxyPort == 0 {
+		proxyPort = proxyResolved.port
+	}
+	if proxyPort == 0 {
+		proxyPort = defaultSSHPort
+	}
+
+	proxyConfig, err := defaultClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxyUser != "" {
+		proxyConfig.User = proxyUser
+	}
+	addIdentityAuth(proxyConfig, proxyResolved.identityFiles)
+
+	proxyAddr := fmt.Sprintf("%s:%d", proxyResolved.hostname, proxyPort)
+	proxyClient, err := ssh.Dial("tcp", proxyAddr, proxyConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not dial ProxyJump %#v: %s", proxyJump, err.Error())
+	}
+
+	conn, err := proxyClient.Dial("tcp", addr)
+	if err != nil {
+		proxyClient.Close()
+		return nil, nil, err
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		proxyClient.Close()
+		return nil, nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), proxyClient, nil
+}
+
+// connectSFTP returns both the SSH connection and SFTP client since they
+// both need to be closed. serverConfig.hostname is resolved against
+// ~/.ssh/config first, so a URL like sftp://myhost/data can reuse an
+// alias already set up for ssh(1): its HostName, User, Port,
+// IdentityFile(s) and ProxyJump all apply, with anything explicit in the
+// URL itself taking precedence. The port is the exception: a URL port of
+// 22 is not told apart from no port, so an ssh_config Port overrides it.
+func connectSFTP(serverConfig sftpSource) (*sshConnection, *sftp.Client, error) {
+	resolved := resolveSSHConfig(serverConfig.hostname)
+
+	clientConfig, err := defaultClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	username := serverConfig.username
+	if username == "" {
+		username = resolved.user
+	}
+	if username != "" {
+		clientConfig.User = username
+	}
+
+	addIdentityAuth(clientConfig, resolved.identityFiles)
+
+	if serverConfig.password != "" {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.Password(serverConfig.password))
+	} else {
+		promptFunc := makePasswordPromptFunc(clientConfig.User, serverConfig.hostname)
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PasswordCallback(promptFunc))
+	}
+
+	port := serverConfig.port
+	if port == defaultSSHPort && resolved.port != 0 {
+		port = resolved.port
+	}
+	addr := fmt.Sprintf("%s:%d", resolved.hostname, port)
+
+	client, proxyClient, err := dialSSH(addr, clientConfig, resolved.proxyJump)
+	if err != nil {
+		return nil, nil, err
+	}
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		if proxyClient != nil {
+			proxyClient.Close()
+		}
+		return nil, nil, err
+	}
+	return &sshConnection{client: client, proxyClient: proxyClient}, sftpClient, nil
+}
+
+// sshConnection bundles the ssh.Client used for the sync with the
+// ProxyJump client it tunnels through, if any, so both get closed
+// together.
+type sshConnection struct {
+	client      *ssh.Client
+	proxyClient *ssh.Client
+}
+
+func (c *sshConnection) Close() error {
+	err := c.client.Close()
+	if c.proxyClient != nil {
+		if proxyErr := c.proxyClient.Close(); err == nil {
+			err = proxyErr
+		}
+	}
+	return err
+}
+
+// sftpFilesystem adapts an *sftp.Client to the Filesystem interface.
+type sftpFilesystem struct {
+	sshConn    *sshConnection
+	sftpClient *sftp.Client
+}
+
+func (f *sftpFilesystem) Open(path string) (io.ReadCloser, error) {
+	return f.sftpClient.Open(path)
+}
+
+func (f *sftpFilesystem) Stat(path string) (os.FileInfo, error) {
+	return f.sftpClient.Stat(path)
+}
+
+func (f *sftpFilesystem) Walk(root string) Walker {
+	return f.sftpClient.Walk(root)
+}
+
+func (f *sftpFilesystem) NewWriter(ctx context.Context, path string) (io.WriteCloser, error) {
+	return f.sftpClient.Create(path)
+}
+
+// NewRangeReader does not limit the reader to length bytes: it reads from
+// offset through to the end of the file.
+func (f *sftpFilesystem) NewRangeReader(
+	ctx context.Context, path string, offset, length int64,
+) (RangeReader, error) {
+	info, err := f.sftpClient.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.sftpClient.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset != 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &sftpRangeReader{File: file, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func (f *sftpFilesystem) Remove(ctx context.Context, path string) error {
+	return f.sftpClient.Remove(path)
+}
+
+func (f *sftpFilesystem) IsNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+func (f *sftpFilesystem) Close() error {
+	sftpErr := f.sftpClient.Close()
+	sshErr := f.sshConn.Close()
+	if sftpErr != nil {
+		return sftpErr
+	}
+	return sshErr
+}
+
+type sftpRangeReader struct {
+	*sftp.File
+	modTime time.Time
+	size    int64
+}
+
+func (r *sftpRangeReader) ModTime() time.Time {
+	return r.modTime
+}
+
+func (r *sftpRangeReader) Size() int64 {
+	return r.size
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jobStats tracks the runtime counters exposed on the status endpoint for
+// a single job, accumulated across every run since the process started.
+type jobStats struct {
+	mu         sync.Mutex
+	lastRun    time.Time
+	lastError  string
+	errorCount int64
+
+	bytesTransferred int64 // updated atomically from inside runSync()
+}
+
+func (s *jobStats) recordRun(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = time.Now()
+	if err != nil {
+		s.errorCount++
+		s.lastError = err.Error()
+	} else {
+		s.lastError = ""
+	}
+}
+
+func (s *jobStats) snapshot() (lastRun time.Time, bytesTransferred int64, errorCount int64, lastError string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun, atomic.LoadInt64(&s.bytesTransferred), s.errorCount, s.lastError
+}
+
+// runningJob pairs a JobConfig with the stats accumulated across its runs.
+type runningJob struct {
+	config JobConfig
+	stats  jobStats
+}
+
+// runOnce opens the job's source and destination, runs a single sync
+// pass, and records the result in j.stats. The filesystems are opened
+// fresh on every call, so this is safe to invoke repeatedly from a cron
+// schedule without connections accumulating between runs.
+func (j *runningJob) runOnce() error {
+	log.Printf("job %#v: starting", j.config.Name)
+	err := j.syncOnce()
+	j.stats.recordRun(err)
+	if err != nil {
+		log.Printf("job %#v: failed: %s", j.config.Name, err.Error())
+		return err
+	}
+	log.Printf("job %#v: completed", j.config.Name)
+	return nil
+}
+
+func (j *runningJob) syncOnce() error {
+	limiter, err := newBandwidthLimiter(j.config.Bandwidth)
+	if err != nil {
+		return err
+	}
+
+	source, sourcePath, err := openFilesystemURL(j.config.Source)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, destinationPath, err := openFilesystemURL(j.config.Destination)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	statePath, err := defaultStatePath(j.config.Source, j.config.Destination)
+	if err != nil {
+		return err
+	}
+	bidirStatePath, err := defaultBidirStatePath(j.config.Source, j.config.Destination)
+	if err != nil {
+		return err
+	}
+
+	mode, err := parseSyncMode(j.config.Mode)
+	if err != nil {
+		return err
+	}
+	conflict, err := parseConflictPolicy(j.config.Conflict)
+	if err != nil {
+		return err
+	}
+
+	opts := syncOptions{
+		Chunked:          j.config.Chunked,
+		VerifyChunked:    j.config.VerifyChunked,
+		Concurrency:      j.config.Concurrency,
+		StatePath:        statePath,
+		Include:          j.config.Include,
+		Exclude:          j.config.Exclude,
+		Limiter:          limiter,
+		BytesTransferred: &j.stats.bytesTransferred,
+		Mode:             mode,
+		Conflict:         conflict,
+		BidirStatePath:   bidirStatePath,
+	}
+
+	err = runSyncMode(source, sourcePath, destination, destinationPath, opts)
+	if err != nil {
+		return err
+	}
+	if closeErr := source.Close(); closeErr != nil {
+		return closeErr
+	}
+	return destination.Close()
+}
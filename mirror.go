@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// chunkStoreRelativePath is the relative path, under a sync root, at
+// which chunked uploads (see chunkStorePath) store their content-
+// addressed blobs. mirrorDeletions excludes it: it holds blobs keyed by
+// hash rather than source path, so a source-vs-destination path
+// comparison has nothing to match it against and would otherwise delete
+// every chunk out from under the manifests that reference them.
+const chunkStoreRelativePath = "chunks"
+
+// mirrorDeletions removes every file under dstPath that has no
+// corresponding file under srcPath and matches opts.Include/opts.Exclude,
+// so the destination ends up an exact mirror of the filtered source tree
+// instead of only ever growing. It is meant to run after the regular push
+// pass, so a deletion can never race an in-flight upload of the same
+// path.
+func mirrorDeletions(src Filesystem, srcPath string, dst Filesystem, dstPath string, opts syncOptions) error {
+	srcPaths, err := listFiles(src, srcPath)
+	if err != nil {
+		return err
+	}
+
+	walker := dst.Walk(dstPath)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return walker.Err()
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+		relativePath := makeDestinationPath(dstPath, walker.Path(), "/")
+		if relativePath == chunkStoreRelativePath || strings.HasPrefix(relativePath, chunkStoreRelativePath+"/") {
+			continue
+		}
+		if !matchesFilters(relativePath, opts.Include, opts.Exclude) {
+			continue
+		}
+		if _, ok := srcPaths[relativePath]; ok {
+			continue
+		}
+		log.Printf("%s: deleting; no longer present in source", walker.Path())
+		if err := dst.Remove(context.Background(), walker.Path()); err != nil {
+			return err
+		}
+	}
+	return walker.Err()
+}
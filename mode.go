@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// syncMode selects what runSyncMode does beyond the basic push copy.
+type syncMode string
+
+const (
+	modePush   syncMode = "push"
+	modeMirror syncMode = "mirror"
+	modeBidir  syncMode = "bidir"
+)
+
+func parseSyncMode(s string) (syncMode, error) {
+	switch syncMode(s) {
+	case modePush, modeMirror, modeBidir:
+		return syncMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid -mode %#v: must be one of push, mirror, bidir", s)
+	}
+}
+
+// runSyncMode is the entry point main and the job scheduler both call in
+// place of runSync() directly: push mode is exactly runSync(), mirror
+// mode follows it with a deletion pass, and bidir mode replaces it
+// entirely with a two-way reconciliation.
+func runSyncMode(src Filesystem, srcPath string, dst Filesystem, dstPath string, opts syncOptions) error {
+	switch opts.Mode {
+	case modeBidir:
+		return syncBidir(src, srcPath, dst, dstPath, opts.BidirStatePath, opts.Conflict)
+	case modeMirror:
+		if err := runSync(src, srcPath, dst, dstPath, opts); err != nil {
+			return err
+		}
+		return mirrorDeletions(src, srcPath, dst, dstPath, opts)
+	default:
+		return runSync(src, srcPath, dst, dstPath, opts)
+	}
+}
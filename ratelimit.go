@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+var bandwidthPattern = regexp.MustCompile(`(?i)^([0-9]+(?:\.[0-9]+)?)\s*(B|KB|MB|GB)(?:/s)?$`)
+
+// parseBandwidth parses a limit like "10MB/s" or "500KB" into bytes per
+// second.
+func parseBandwidth(s string) (float64, error) {
+	matches := bandwidthPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid bandwidth limit %#v, expected e.g. \"10MB/s\"", s)
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToUpper(matches[2]) {
+	case "B":
+		return value, nil
+	case "KB":
+		return value * 1024, nil
+	case "MB":
+		return value * 1024 * 1024, nil
+	case "GB":
+		return value * 1024 * 1024 * 1024, nil
+	}
+	return 0, fmt.Errorf("invalid bandwidth unit in %#v", s)
+}
+
+// maxRateLimiterChunk bounds how many bytes a single Read is allowed to
+// throttle in one WaitN call; it doubles as the limiter's burst so a
+// single Read, however large the caller's buffer, never exceeds the burst
+// and errors out.
+const maxRateLimiterChunk = 256 * 1024
+
+// newBandwidthLimiter builds a token-bucket limiter from a "10MB/s"-style
+// string, or returns nil (no limit) for an empty string.
+func newBandwidthLimiter(s string) (*rate.Limiter, error) {
+	if s == "" {
+		return nil, nil
+	}
+	bytesPerSecond, err := parseBandwidth(s)
+	if err != nil {
+		return nil, err
+	}
+	burst := maxRateLimiterChunk
+	if bytesPerSecond > float64(burst) {
+		burst = int(bytesPerSecond)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst), nil
+}
+
+// newRateLimitedReader wraps r so that reading from it blocks long enough
+// to respect limiter's rate; a nil limiter (no -bandwidth cap) is a
+// no-op passthrough.
+func newRateLimitedReader(r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: limiter}
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *rateLimitedReader) Read(buf []byte) (int, error) {
+	if len(buf) > maxRateLimiterChunk {
+		buf = buf[:maxRateLimiterChunk]
+	}
+	n, err := r.r.Read(buf)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(context.Background(), n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
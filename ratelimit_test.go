@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseBandwidth(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{input: "10MB/s", want: 10 * 1024 * 1024},
+		{input: "500KB", want: 500 * 1024},
+		{input: "1GB/s", want: 1024 * 1024 * 1024},
+		{input: "42B", want: 42},
+		{input: "", wantErr: true},
+		{input: "fast", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseBandwidth(c.input)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseBandwidth(%#v) = %v, nil; expected an error", c.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBandwidth(%#v) error: %s", c.input, err.Error())
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseBandwidth(%#v) = %v; expected %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestNewBandwidthLimiterEmptyIsUnlimited(t *testing.T) {
+	limiter, err := newBandwidthLimiter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limiter != nil {
+		t.Errorf("newBandwidthLimiter(\"\") = %v; expected nil", limiter)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const maxRetries = 5
+const initialBackoff = 500 * time.Millisecond
+const maxBackoff = 30 * time.Second
+
+// withRetry calls fn, retrying with exponential backoff (plus jitter) on
+// transient errors, up to maxRetries attempts. description is used only
+// for the retry log line. ctx cancellation aborts the wait immediately.
+func withRetry(ctx context.Context, description string, fn func() error) error {
+	backoff := initialBackoff
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if !isTransientErr(err) || attempt == maxRetries {
+			return err
+		}
+		log.Printf("%s: retrying after transient error (attempt %d/%d): %s",
+			description, attempt+1, maxRetries, err.Error())
+		jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+		select {
+		case <-time.After(backoff + jitter):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return err
+}
+
+// isTransientErr reports whether err looks like a transient network
+// error worth retrying, as opposed to e.g. a permission or not-found
+// error that will just fail again.
+func isTransientErr(err error) bool {
+	type temporary interface {
+		Temporary() bool
+	}
+	if t, ok := err.(temporary); ok && t.Temporary() {
+		return true
+	}
+	type timeout interface {
+		Timeout() bool
+	}
+	if t, ok := err.(timeout); ok && t.Timeout() {
+		return true
+	}
+	return err == io.ErrUnexpectedEOF || err == io.ErrClosedPipe
+}
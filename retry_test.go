@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestWithRetrySucceedsAfterTransientErrors(t *testing.T) {
+	attempts := 0
+	transientErr := &net.DNSError{IsTimeout: true}
+	err := withRetry(context.Background(), "test", func() error {
+		attempts++
+		if attempts < 3 {
+			return transientErr
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withRetry() = %#v; expected nil", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d; expected 3", attempts)
+	}
+}
+
+func TestWithRetryDoesNotRetryPermanentErrors(t *testing.T) {
+	attempts := 0
+	permanentErr := errors.New("permission denied")
+	err := withRetry(context.Background(), "test", func() error {
+		attempts++
+		return permanentErr
+	})
+	if err != permanentErr {
+		t.Errorf("withRetry() = %#v; expected %#v", err, permanentErr)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d; expected 1", attempts)
+	}
+}
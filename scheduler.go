@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/robfig/cron/v3"
+)
+
+// runDaemon runs every job in config once, then keeps running: jobs with
+// a Schedule are re-run by cron on their own cadence, and if Addr is set
+// an HTTP server exposes their stats in Prometheus text format. With Addr
+// empty it blocks forever; otherwise it returns only if the HTTP server
+// fails.
+func runDaemon(config *Config) error {
+	jobs := make([]*runningJob, len(config.Jobs))
+	for i, jobConfig := range config.Jobs {
+		jobs[i] = &runningJob{config: jobConfig}
+	}
+
+	scheduler := cron.New()
+	for _, job := range jobs {
+		job := job
+		if job.config.Schedule == "" {
+			go job.runOnce()
+			continue
+		}
+		// SkipIfStillRunning guards against a run that takes longer than
+		// its own schedule (a slow SFTP link, a large tree): without it,
+		// cron would start a second, overlapping syncOnce() against the
+		// same state file and destination paths.
+		wrapped := cron.NewChain(cron.SkipIfStillRunning(cron.DefaultLogger)).Then(cron.FuncJob(func() { job.runOnce() }))
+		if _, err := scheduler.AddJob(job.config.Schedule, wrapped); err != nil {
+			return fmt.Errorf("job %#v: invalid schedule %#v: %s", job.config.Name, job.config.Schedule, err.Error())
+		}
+		// also run once at startup, same as an unscheduled job, so the
+		// daemon doesn't sit idle until the first cron tick
+		go job.runOnce()
+	}
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	if config.Addr == "" {
+		select {}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", statusHandler(jobs))
+	log.Printf("status endpoint listening on %s", config.Addr)
+	return http.ListenAndServe(config.Addr, mux)
+}
+
+// statusHandler renders each job's stats in Prometheus text exposition
+// format: https://prometheus.io/docs/instrumenting/exposition_formats/
+func statusHandler(jobs []*runningJob) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# HELP sftpsync_job_last_run_timestamp_seconds Unix time of the job's last run.")
+		fmt.Fprintln(w, "# TYPE sftpsync_job_last_run_timestamp_seconds gauge")
+		for _, job := range jobs {
+			lastRun, _, _, _ := job.stats.snapshot()
+			if lastRun.IsZero() {
+				continue
+			}
+			fmt.Fprintf(w, "sftpsync_job_last_run_timestamp_seconds{job=%q} %d\n", job.config.Name, lastRun.Unix())
+		}
+
+		fmt.Fprintln(w, "# HELP sftpsync_job_bytes_transferred_total Bytes transferred by the job since the process started.")
+		fmt.Fprintln(w, "# TYPE sftpsync_job_bytes_transferred_total counter")
+		for _, job := range jobs {
+			_, bytesTransferred, _, _ := job.stats.snapshot()
+			fmt.Fprintf(w, "sftpsync_job_bytes_transferred_total{job=%q} %d\n", job.config.Name, bytesTransferred)
+		}
+
+		fmt.Fprintln(w, "# HELP sftpsync_job_errors_total Number of failed runs of the job since the process started.")
+		fmt.Fprintln(w, "# TYPE sftpsync_job_errors_total counter")
+		for _, job := range jobs {
+			_, _, errorCount, _ := job.stats.snapshot()
+			fmt.Fprintf(w, "sftpsync_job_errors_total{job=%q} %d\n", job.config.Name, errorCount)
+		}
+	}
+}
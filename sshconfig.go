@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// resolvedHost is what a host alias (an sftp:// URL's hostname) resolves
+// to after consulting ~/.ssh/config, the same way ssh(1)/scp(1) would
+// for "ssh myhost": a real hostname, and whatever User/Port/IdentityFile/
+// ProxyJump directives apply to it.
+type resolvedHost struct {
+	hostname      string
+	port          int
+	user          string
+	identityFiles []string
+	proxyJump     string
+}
+
+// resolveSSHConfig resolves alias against the user's ssh_config so a URL
+// like sftp://myhost/data can reuse the same alias already set up for
+// ssh(1).
+func resolveSSHConfig(alias string) resolvedHost {
+	resolved := resolvedHost{hostname: alias}
+
+	if hostName := ssh_config.Get(alias, "HostName"); hostName != "" {
+		resolved.hostname = hostName
+	}
+	if user := ssh_config.Get(alias, "User"); user != "" {
+		resolved.user = user
+	}
+	if portString := ssh_config.Get(alias, "Port"); portString != "" {
+		if port, err := strconv.Atoi(portString); err == nil {
+			resolved.port = port
+		}
+	}
+	resolved.proxyJump = ssh_config.Get(alias, "ProxyJump")
+
+	for _, identityFile := range ssh_config.GetAll(alias, "IdentityFile") {
+		path, err := expandHome(identityFile)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			resolved.identityFiles = append(resolved.identityFiles, path)
+		}
+	}
+
+	return resolved
+}
+
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// parseProxyJump splits a ProxyJump value (e.g. "user@jumphost:2222")
+// into its user, host and port parts; any of them may be empty/zero if
+// not specified, to be filled in from ssh_config or defaults.
+func parseProxyJump(proxyJump string) (host string, user string, port int) {
+	spec := proxyJump
+	if idx := strings.Index(spec, "@"); idx >= 0 {
+		user = spec[:idx]
+		spec = spec[idx+1:]
+	}
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		if p, err := strconv.Atoi(spec[idx+1:]); err == nil {
+			port = p
+		}
+		spec = spec[:idx]
+	}
+	return spec, user, port
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// syncState records, for each relative path under the sync root, the
+// mtime and size last confirmed to be in sync, so a later run can skip
+// unchanged files without round-tripping to the destination just to read
+// its mtime. It also tracks paths that were mid-copy when the process
+// last exited, so an interrupted sync re-copies them rather than trusting
+// a possibly-partial upload.
+type syncState struct {
+	mu   sync.Mutex
+	path string
+
+	Files      map[string]fileState `json:"files"`
+	InProgress map[string]bool      `json:"inProgress"`
+}
+
+type fileState struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+}
+
+// defaultStatePath derives a stable state file location from the source
+// and destination URLs, so repeated invocations of the same sync reuse
+// (and can resume from) the same state without the user naming one.
+func defaultStatePath(sourceURL string, destinationURL string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	dir := filepath.Join(cacheDir, "sftpsync")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(sourceURL + "\x00" + destinationURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+func loadSyncState(path string) (*syncState, error) {
+	state := &syncState{path: path, Files: map[string]fileState{}, InProgress: map[string]bool{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = map[string]fileState{}
+	}
+	if state.InProgress == nil {
+		state.InProgress = map[string]bool{}
+	}
+	return state, nil
+}
+
+// save writes the state file atomically: to a uniquely-named temp file in
+// the same directory, then renamed into place, so a crash mid-write can't
+// leave a corrupt state file for the next run to choke on. The temp file
+// needs a unique name per call (rather than a fixed "path+.tmp"), since
+// markInProgress/markDone call save() from every worker goroutine in
+// sync's pool, and two goroutines sharing one tmp path can race: one's
+// os.Rename can fire after another has already renamed the same path
+// away, leaving the first with nothing to rename.
+func (s *syncState) save() error {
+	s.mu.Lock()
+	data, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return writeErr
+	}
+	if closeErr != nil {
+		os.Remove(tmpPath)
+		return closeErr
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// isUpToDate reports whether relativePath is known to already match
+// info, and wasn't left in-progress by an interrupted previous run.
+func (s *syncState) isUpToDate(relativePath string, info os.FileInfo) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.InProgress[relativePath] {
+		return false
+	}
+	prev, ok := s.Files[relativePath]
+	if !ok {
+		return false
+	}
+	return prev.ModTime.Equal(info.ModTime().Truncate(time.Second)) && prev.Size == info.Size()
+}
+
+func (s *syncState) markInProgress(relativePath string) error {
+	s.mu.Lock()
+	s.InProgress[relativePath] = true
+	s.mu.Unlock()
+	return s.save()
+}
+
+func (s *syncState) markDone(relativePath string, info os.FileInfo) error {
+	s.mu.Lock()
+	delete(s.InProgress, relativePath)
+	s.Files[relativePath] = fileState{ModTime: info.ModTime().Truncate(time.Second), Size: info.Size()}
+	s.mu.Unlock()
+	return s.save()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeFileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+func (i fakeFileInfo) Name() string       { return "fake" }
+func (i fakeFileInfo) Size() int64        { return i.size }
+func (i fakeFileInfo) Mode() os.FileMode  { return 0 }
+func (i fakeFileInfo) ModTime() time.Time { return i.modTime }
+func (i fakeFileInfo) IsDir() bool        { return false }
+func (i fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestSyncStateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftpsync-state-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state.json")
+
+	state, err := loadSyncState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := fakeFileInfo{modTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), size: 42}
+	if state.isUpToDate("a/b", info) {
+		t.Errorf("isUpToDate on empty state = true; expected false")
+	}
+
+	if err := state.markInProgress("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if state.isUpToDate("a/b", info) {
+		t.Errorf("isUpToDate while in progress = true; expected false")
+	}
+	if err := state.markDone("a/b", info); err != nil {
+		t.Fatal(err)
+	}
+	if !state.isUpToDate("a/b", info) {
+		t.Errorf("isUpToDate after markDone = false; expected true")
+	}
+
+	reloaded, err := loadSyncState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.isUpToDate("a/b", info) {
+		t.Errorf("isUpToDate after reload = false; expected true")
+	}
+
+	changed := fakeFileInfo{modTime: info.modTime, size: 43}
+	if reloaded.isUpToDate("a/b", changed) {
+		t.Errorf("isUpToDate with changed size = true; expected false")
+	}
+}